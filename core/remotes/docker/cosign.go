@@ -0,0 +1,194 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Cosign tags a subject's attachments by mangling its digest into a tag and
+// appending one of these suffixes, instead of listing them as referrers.
+// See https://github.com/sigstore/cosign/blob/main/specs/SIGNATURE_SPEC.md
+const (
+	cosignSignatureSuffix   = ".sig"
+	cosignAttestationSuffix = ".att"
+	cosignSBOMSuffix        = ".sbom"
+)
+
+// cosignArtifactTypes maps a Cosign tag suffix to the artifactType used to
+// describe it in a synthesized referrers index, since the legacy Cosign
+// manifests don't carry one themselves.
+var cosignArtifactTypes = map[string]string{
+	cosignSignatureSuffix:   "application/vnd.dev.cosign.simplesigning.v1+json",
+	cosignAttestationSuffix: "application/vnd.dev.cosign.attestation.v1+json",
+	cosignSBOMSuffix:        "application/vnd.dev.cosign.sbom.v1+json",
+}
+
+// cosignTag computes the Cosign tag for one of a subject's attachments,
+// e.g. "sha256-abcdef....sig".
+func cosignTag(dgst digest.Digest, suffix string) string {
+	return strings.Replace(dgst.String(), ":", "-", 1) + suffix
+}
+
+// fetchCosignIndex probes the Cosign signature, attestation and SBOM tags
+// for dgst and synthesizes a single OCI image index listing whichever of
+// them exist, so callers get the same shape of result regardless of
+// whether the attachments live under the OCI 1.1 API or the Cosign tag
+// schema.
+func (r dockerFetcher) fetchCosignIndex(ctx context.Context, host RegistryHost, dgst digest.Digest) (io.ReadCloser, int64, error) {
+	var manifests []ocispec.Descriptor
+	for _, suffix := range []string{cosignSignatureSuffix, cosignAttestationSuffix, cosignSBOMSuffix} {
+		desc, err := r.resolveCosignAttachment(ctx, host, dgst, suffix)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			return nil, 0, err
+		}
+		manifests = append(manifests, desc)
+	}
+
+	if len(manifests) == 0 {
+		return nil, 0, fmt.Errorf("no cosign attachments for %s: %w", dgst, errdefs.ErrNotFound)
+	}
+
+	return encodeCosignIndex(manifests)
+}
+
+// encodeCosignIndex marshals manifests as an OCI image index, the shape
+// fetchCosignIndex synthesizes so a Cosign-fallback result looks the same
+// to callers as one the referrers API would have returned.
+func encodeCosignIndex(manifests []ocispec.Descriptor) (io.ReadCloser, int64, error) {
+	idx := ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: manifests,
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+// resolveCosignAttachment fetches the manifest tagged with dgst's Cosign tag
+// for the given suffix and builds a descriptor for it, since the tag-based
+// lookup doesn't give us one the way the referrers API would.
+func (r dockerFetcher) resolveCosignAttachment(ctx context.Context, host RegistryHost, dgst digest.Digest, suffix string) (ocispec.Descriptor, error) {
+	req := r.request(host, http.MethodGet, "manifests", cosignTag(dgst, suffix))
+	if err := req.addNamespace(r.refspec.Hostname()); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	rc, _, hdr, err := r.open(ctx, req, ocispec.MediaTypeImageManifest, 0, true)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer rc.Close()
+	r.surfaceWarnings(ctx, hdr)
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("parsing cosign %q manifest: %w", suffix, err)
+	}
+	mediaType := manifest.MediaType
+	if mediaType == "" {
+		mediaType = ocispec.MediaTypeImageManifest
+	}
+
+	return ocispec.Descriptor{
+		MediaType:    mediaType,
+		Digest:       digest.FromBytes(data),
+		Size:         int64(len(data)),
+		ArtifactType: cosignArtifactTypes[suffix],
+	}, nil
+}
+
+// cosignAttachmentSuffix maps the "sig", "att" or "sbom" kind accepted by
+// PutCosignAttachment to its Cosign tag suffix.
+func cosignAttachmentSuffix(kind string) (string, error) {
+	switch kind {
+	case "sig":
+		return cosignSignatureSuffix, nil
+	case "att":
+		return cosignAttestationSuffix, nil
+	case "sbom":
+		return cosignSBOMSuffix, nil
+	default:
+		return "", fmt.Errorf("unknown cosign attachment kind %q: %w", kind, errdefs.ErrInvalidArgument)
+	}
+}
+
+// PutCosignAttachment uploads manifest under the Cosign tag for kind ("sig",
+// "att" or "sbom"), so containerd-based tooling can write the legacy Cosign
+// layout, not just read it.
+func (p dockerPusher) PutCosignAttachment(ctx context.Context, subject digest.Digest, kind string, manifest ocispec.Manifest) (ocispec.Descriptor, error) {
+	suffix, err := cosignAttachmentSuffix(kind)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = ocispec.MediaTypeImageManifest
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc := ocispec.Descriptor{
+		MediaType: manifest.MediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+
+	hosts := p.filterHosts(HostCapabilityPush)
+	if len(hosts) == 0 {
+		return ocispec.Descriptor{}, fmt.Errorf("no push hosts: %w", errdefs.ErrNotFound)
+	}
+
+	ctx, err = ContextWithRepositoryScope(ctx, p.refspec, true)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	var lastErr error
+	for _, host := range hosts {
+		if err := p.putManifest(ctx, host, cosignTag(subject, suffix), data, desc.MediaType); err != nil {
+			lastErr = err
+			continue
+		}
+		return desc, nil
+	}
+
+	return ocispec.Descriptor{}, fmt.Errorf("could not push cosign %s attachment to any host: %w", kind, lastErr)
+}
@@ -0,0 +1,82 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestEncodeCosignIndex(t *testing.T) {
+	manifests := []ocispec.Descriptor{
+		{
+			MediaType:    ocispec.MediaTypeImageManifest,
+			Digest:       digest.FromString("sig"),
+			Size:         1,
+			ArtifactType: cosignArtifactTypes[cosignSignatureSuffix],
+		},
+		{
+			MediaType:    ocispec.MediaTypeImageManifest,
+			Digest:       digest.FromString("att"),
+			Size:         2,
+			ArtifactType: cosignArtifactTypes[cosignAttestationSuffix],
+		},
+	}
+
+	rc, size, err := encodeCosignIndex(manifests)
+	if err != nil {
+		t.Fatalf("encodeCosignIndex returned error: %v", err)
+	}
+	defer rc.Close()
+
+	descs, err := decodeReferrersIndex(rc)
+	if err != nil {
+		t.Fatalf("decoding synthesized index: %v", err)
+	}
+	if len(descs) != len(manifests) {
+		t.Fatalf("got %d manifests, want %d", len(descs), len(manifests))
+	}
+	for i, d := range descs {
+		if d.Digest != manifests[i].Digest || d.ArtifactType != manifests[i].ArtifactType {
+			t.Errorf("manifest %d = %+v, want %+v", i, d, manifests[i])
+		}
+	}
+	if size <= 0 {
+		t.Errorf("got size %d, want > 0", size)
+	}
+}
+
+func TestArtifactTypeAllowed(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		allowed      []string
+		artifactType string
+		want         bool
+	}{
+		{name: "no filter allows everything", allowed: nil, artifactType: "application/vnd.example", want: true},
+		{name: "matching type", allowed: []string{"a", "b"}, artifactType: "b", want: true},
+		{name: "non-matching type", allowed: []string{"a", "b"}, artifactType: "c", want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := artifactTypeAllowed(tc.allowed, tc.artifactType); got != tc.want {
+				t.Errorf("artifactTypeAllowed(%v, %q) = %v, want %v", tc.allowed, tc.artifactType, got, tc.want)
+			}
+		})
+	}
+}
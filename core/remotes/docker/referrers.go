@@ -17,10 +17,13 @@
 package docker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/containerd/errdefs"
@@ -29,7 +32,101 @@ import (
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+// filtersAppliedHeader is the distribution-spec response header a registry
+// sets to tell the client which query filters it already honored. Filters
+// absent from it must still be applied client-side.
+const filtersAppliedHeader = "OCI-Filters-Applied"
+
+// Warning is a single RFC 7234 Warning header value, as surfaced to a
+// HandleWarning callback.
+type Warning struct {
+	// Code is the 3-digit warn-code, e.g. 299 for "Miscellaneous Persistent Warning".
+	Code int
+	// Agent identifies the server that produced the warning.
+	Agent string
+	// Text is the human-readable warning text.
+	Text string
+}
+
+// FetchReferrersOption configures a FetchReferrers call.
+type FetchReferrersOption func(*fetchReferrersConfig)
+
+type fetchReferrersConfig struct {
+	artifactTypes     []string
+	annotations       map[string]string
+	cosignFallback    bool
+	cosignAttachments bool
+}
+
+// WithReferrersArtifactType restricts the returned referrers to the given
+// artifact type. It may be passed multiple times to request more than one
+// type. Registries that support the referrers API are free to ignore this
+// and return the full, unfiltered list, in which case FetchReferrers applies
+// the filter itself before returning.
+func WithReferrersArtifactType(artifactType string) FetchReferrersOption {
+	return func(c *fetchReferrersConfig) {
+		c.artifactTypes = append(c.artifactTypes, artifactType)
+	}
+}
+
+// WithCosignFallback enables the legacy Cosign tag-schema probe
+// (`<alg>-<hex>.sig`) as a last-resort fallback when a host has neither the
+// referrers API nor the OCI 1.1 referrers tag schema available. This is
+// opt-in: the spec-compliant tag schema is tried first and is sufficient for
+// any registry that has caught up with distribution-spec v1.1, so the
+// Cosign-specific probe is only useful against older registries that
+// predate it.
+func WithCosignFallback() FetchReferrersOption {
+	return func(c *fetchReferrersConfig) {
+		c.cosignFallback = true
+	}
+}
+
+// WithCosignAttachments extends the Cosign fallback to also probe the
+// `.att` (attestation) and `.sbom` tags, in addition to `.sig`, synthesizing
+// a single OCI image index from whichever of the three exist. It implies
+// WithCosignFallback. Strict OCI 1.1 consumers that only want the spec
+// paths should leave this unset; the synthesized index is otherwise
+// indistinguishable from one the referrers API itself would have returned.
+func WithCosignAttachments() FetchReferrersOption {
+	return func(c *fetchReferrersConfig) {
+		c.cosignFallback = true
+		c.cosignAttachments = true
+	}
+}
+
+// referrersFallbackTag computes the OCI 1.1 distribution-spec fallback tag
+// for the referrers of dgst, e.g. "sha256-abcdef...". See
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#referrers-tag-schema
+func referrersFallbackTag(dgst digest.Digest) string {
+	return fmt.Sprintf("%s-%s", dgst.Algorithm(), dgst.Encoded())
+}
+
+// FetchReferrers fetches the referrers of dgst, optionally restricted to
+// the given artifact types. It is kept around as a compatibility shim for
+// the original variadic-artifactType signature; callers that need the
+// fuller set of FetchReferrersOption knobs (Cosign fallback) should call
+// FetchReferrersWithOptions instead.
 func (r dockerFetcher) FetchReferrers(ctx context.Context, dgst digest.Digest, artifactTypes ...string) (io.ReadCloser, ocispec.Descriptor, error) {
+	opts := make([]FetchReferrersOption, 0, len(artifactTypes))
+	for _, t := range artifactTypes {
+		opts = append(opts, WithReferrersArtifactType(t))
+	}
+	return r.FetchReferrersWithOptions(ctx, dgst, opts...)
+}
+
+// FetchReferrersWithOptions fetches the referrers of dgst as described by
+// opts, returning the (possibly synthesized) OCI image index listing them.
+// The one exception is the plain Cosign fallback (WithCosignFallback without
+// WithCosignAttachments): it returns the Cosign signature manifest itself,
+// while the returned descriptor still names an image index media type.
+// Annotation filters (WithReferrerAnnotation) are not applied here.
+func (r dockerFetcher) FetchReferrersWithOptions(ctx context.Context, dgst digest.Digest, opts ...FetchReferrersOption) (io.ReadCloser, ocispec.Descriptor, error) {
+	var config fetchReferrersConfig
+	for _, o := range opts {
+		o(&config)
+	}
+
 	var desc ocispec.Descriptor
 	// The referrers endpoint returns an image index
 	// The image index contains a list of referrer references.
@@ -47,13 +144,11 @@ func (r dockerFetcher) FetchReferrers(ctx context.Context, dgst digest.Digest, a
 	}
 
 	for _, host := range hosts {
-		fmt.Printf("Trying to fetch referrers from host: %s\n", host.Host)
-		fmt.Printf("Host capabilities include referrers: %t\n", host.Capabilities.Has(HostCapabilityReferrers))
-		fmt.Printf("Host capabilities include resolve: %t\n", host.Capabilities.Has(HostCapabilityResolve))
-		var req *request
+		log.G(ctx).WithField("host", host.Host).Debug("trying to fetch referrers")
+
 		if host.Capabilities.Has(HostCapabilityReferrers) {
-			req = r.request(host, http.MethodGet, "referrers", dgst.String())
-			for _, artifactType := range artifactTypes {
+			req := r.request(host, http.MethodGet, "referrers", dgst.String())
+			for _, artifactType := range config.artifactTypes {
 				if err := req.addQuery("artifactType", artifactType); err != nil {
 					return nil, desc, err
 				}
@@ -62,40 +157,229 @@ func (r dockerFetcher) FetchReferrers(ctx context.Context, dgst digest.Digest, a
 				return nil, desc, err
 			}
 
-			rc, cl, err := r.open(ctx, req, desc.MediaType, 0, true)
+			rc, cl, hdr, err := r.open(ctx, req, desc.MediaType, 0, true)
 			if err != nil {
 				if !errdefs.IsNotFound(err) {
 					return nil, desc, err
 				}
 			} else {
+				r.surfaceWarnings(ctx, hdr)
+				rc, cl, err = filterUnappliedArtifactTypes(rc, cl, hdr, config.artifactTypes)
+				if err != nil {
+					return nil, desc, err
+				}
 				desc.Size = cl
 				// Digest is not known ahead of time and there is nothing in the distribution
 				// specification defining an HTTP header to return the digest on referrers.
 				return rc, desc, nil
 			}
 		}
-		// Fetch the Cosign signatures which is a manifest with a new tag,
-		// instead of living in the referrers list
-		// This seems a fallback for registries that do not support the referrers
+
+		// Fall back to the OCI 1.1 referrers tag schema: the referrers of
+		// dgst are listed in an image index pushed under the well-known tag
+		// "<alg>-<hex>". This is the preferred fallback for hosts that
+		// haven't enabled the referrers API yet, since it is part of the
+		// distribution spec rather than a Cosign-specific convention. The
+		// registry has no opportunity to apply an artifactType filter here,
+		// so it is always applied client-side.
 		if host.Capabilities.Has(HostCapabilityResolve) {
-			req = r.request(host, http.MethodGet, "manifests", strings.Replace(dgst.String(), ":", "-", 1)+".sig")
-			fmt.Printf("Trying to fetch signatures manifest by tag: %v\n", req)
+			req := r.request(host, http.MethodGet, "manifests", referrersFallbackTag(dgst))
 			if err := req.addNamespace(r.refspec.Hostname()); err != nil {
 				return nil, desc, err
 			}
-			rc, cl, err := r.open(ctx, req, desc.MediaType, 0, true)
+
+			rc, cl, hdr, err := r.open(ctx, req, desc.MediaType, 0, true)
 			if err != nil {
 				if !errdefs.IsNotFound(err) {
 					return nil, desc, err
 				}
 			} else {
+				r.surfaceWarnings(ctx, hdr)
+				rc, cl, err = filterUnappliedArtifactTypes(rc, cl, http.Header{}, config.artifactTypes)
+				if err != nil {
+					return nil, desc, err
+				}
 				desc.Size = cl
-				// Digest could be resolved here the same as for any manifest, don't include the
-				// digest for consistency with the referrers endpoint.
 				return rc, desc, nil
 			}
 		}
+
+		// Last-resort fallback: the Cosign tag schema, which keeps
+		// signatures (and, with WithCosignAttachments, attestations and
+		// SBOMs) under their own tags instead of an image index of
+		// referrers. Only probed when explicitly requested, since it is not
+		// part of any spec and modern registries should already satisfy one
+		// of the cases above.
+		if config.cosignFallback && host.Capabilities.Has(HostCapabilityResolve) {
+			if config.cosignAttachments {
+				rc, cl, err := r.fetchCosignIndex(ctx, host, dgst)
+				if err != nil {
+					if !errdefs.IsNotFound(err) {
+						return nil, desc, err
+					}
+				} else {
+					rc, cl, err = filterUnappliedArtifactTypes(rc, cl, http.Header{}, config.artifactTypes)
+					if err != nil {
+						return nil, desc, err
+					}
+					desc.Size = cl
+					return rc, desc, nil
+				}
+			} else if !artifactTypeAllowed(config.artifactTypes, cosignArtifactTypes[cosignSignatureSuffix]) {
+				// The raw Cosign signature manifest has no artifactType of
+				// its own to filter the way filterUnappliedArtifactTypes
+				// does for an index - its type is implied entirely by the
+				// suffix it's tagged under - so check that directly instead
+				// of returning it unfiltered.
+			} else {
+				req := r.request(host, http.MethodGet, "manifests", cosignTag(dgst, cosignSignatureSuffix))
+				if err := req.addNamespace(r.refspec.Hostname()); err != nil {
+					return nil, desc, err
+				}
+				rc, cl, hdr, err := r.open(ctx, req, desc.MediaType, 0, true)
+				if err != nil {
+					if !errdefs.IsNotFound(err) {
+						return nil, desc, err
+					}
+				} else {
+					r.surfaceWarnings(ctx, hdr)
+					desc.Size = cl
+					// Digest could be resolved here the same as for any manifest, don't include the
+					// digest for consistency with the referrers endpoint.
+					return rc, desc, nil
+				}
+			}
+		}
 	}
 
 	return nil, ocispec.Descriptor{}, fmt.Errorf("could not be found at any host: %w", errdefs.ErrNotFound)
-}
\ No newline at end of file
+}
+
+// surfaceWarnings forwards any RFC 7234 Warning response headers to the
+// fetcher's configured HandleWarning callback, if any. Registries use this
+// to announce deprecations (e.g. an image index format change) without
+// failing the request, so they should not be dropped silently.
+func (r dockerFetcher) surfaceWarnings(ctx context.Context, hdr http.Header) {
+	if r.handleWarning == nil {
+		return
+	}
+	for _, value := range hdr.Values("Warning") {
+		for _, w := range parseWarningHeader(value) {
+			r.handleWarning(ctx, w)
+		}
+	}
+}
+
+// parseWarningHeader parses a single RFC 7234 Warning header value, which
+// may itself contain multiple comma-separated warn-values:
+//
+//	Warning: 299 - "example warning" "Sat, 25 Aug 2012 23:34:45 GMT"
+func parseWarningHeader(value string) []Warning {
+	var warnings []Warning
+	for len(value) > 0 {
+		value = strings.TrimSpace(value)
+		codeEnd := strings.IndexByte(value, ' ')
+		if codeEnd < 0 {
+			break
+		}
+		code, err := strconv.Atoi(value[:codeEnd])
+		if err != nil {
+			break
+		}
+		rest := strings.TrimSpace(value[codeEnd+1:])
+		agentEnd := strings.IndexByte(rest, ' ')
+		if agentEnd < 0 {
+			break
+		}
+		agent := rest[:agentEnd]
+		rest = strings.TrimSpace(rest[agentEnd+1:])
+		if len(rest) == 0 || rest[0] != '"' {
+			break
+		}
+		textEnd := strings.IndexByte(rest[1:], '"')
+		if textEnd < 0 {
+			break
+		}
+		text := rest[1 : textEnd+1]
+		warnings = append(warnings, Warning{Code: code, Agent: agent, Text: text})
+
+		rest = strings.TrimSpace(rest[textEnd+2:])
+		// Skip an optional quoted warn-date before the next warn-value.
+		if len(rest) > 0 && rest[0] == '"' {
+			if dateEnd := strings.IndexByte(rest[1:], '"'); dateEnd >= 0 {
+				rest = strings.TrimSpace(rest[dateEnd+2:])
+			}
+		}
+		rest = strings.TrimPrefix(rest, ",")
+		value = rest
+	}
+	return warnings
+}
+
+// filterUnappliedArtifactTypes applies a client-side artifactType filter to
+// a referrers image index when the server hasn't already confirmed (via the
+// OCI-Filters-Applied header) that it did so itself. If artifactTypes is
+// empty, or the filter was already applied server-side, rc is returned
+// unmodified.
+func filterUnappliedArtifactTypes(rc io.ReadCloser, size int64, hdr http.Header, artifactTypes []string) (io.ReadCloser, int64, error) {
+	if len(artifactTypes) == 0 || appliedFilters(hdr)["artifactType"] {
+		return rc, size, nil
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading referrers index for client-side filtering: %w", err)
+	}
+
+	var idx ocispec.Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, 0, fmt.Errorf("parsing referrers index for client-side filtering: %w", err)
+	}
+
+	allowed := make(map[string]bool, len(artifactTypes))
+	for _, t := range artifactTypes {
+		allowed[t] = true
+	}
+	filtered := idx.Manifests[:0]
+	for _, m := range idx.Manifests {
+		if allowed[m.ArtifactType] {
+			filtered = append(filtered, m)
+		}
+	}
+	idx.Manifests = filtered
+
+	out, err := json.Marshal(idx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("marshaling filtered referrers index: %w", err)
+	}
+	return io.NopCloser(bytes.NewReader(out)), int64(len(out)), nil
+}
+
+// artifactTypeAllowed reports whether artifactType passes the given
+// artifactType filter - every type passes an empty filter.
+func artifactTypeAllowed(allowed []string, artifactType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == artifactType {
+			return true
+		}
+	}
+	return false
+}
+
+// appliedFilters parses the OCI-Filters-Applied header into a set of filter
+// names the registry confirms it already applied, e.g. "artifactType".
+func appliedFilters(hdr http.Header) map[string]bool {
+	applied := map[string]bool{}
+	for _, value := range hdr.Values(filtersAppliedHeader) {
+		for _, f := range strings.Split(value, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				applied[f] = true
+			}
+		}
+	}
+	return applied
+}
@@ -0,0 +1,302 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/log"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// maxReferrersIndexAttempts bounds the read-modify-write retry loop used to
+// update a referrers-tag-schema index, in case of concurrent pushers racing
+// to update the same tag.
+const maxReferrersIndexAttempts = 10
+
+// PushReferrer uploads artifact, an OCI image manifest carrying a "subject"
+// and "artifactType", as a referrer of subject. On hosts that advertise
+// HostCapabilityReferrers a plain manifest PUT is sufficient; the registry
+// discovers the relationship from the manifest's subject field. Otherwise
+// PushReferrer maintains the OCI 1.1 referrers-tag-schema index itself,
+// retrying the read-modify-write loop if it loses a race with a concurrent
+// push to the same fallback tag.
+func (p dockerPusher) PushReferrer(ctx context.Context, subject digest.Digest, artifact ocispec.Manifest, opts ...remotes.PushReferrerOption) (ocispec.Descriptor, error) {
+	var config remotes.PushReferrerConfig
+	for _, o := range opts {
+		o(&config)
+	}
+
+	if artifact.Subject == nil || artifact.Subject.Digest != subject {
+		return ocispec.Descriptor{}, fmt.Errorf("artifact manifest must carry a subject descriptor matching %s: %w", subject, errdefs.ErrInvalidArgument)
+	}
+	if artifact.MediaType == "" {
+		artifact.MediaType = ocispec.MediaTypeImageManifest
+	}
+
+	data, err := json.Marshal(artifact)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc := ocispec.Descriptor{
+		MediaType:    artifact.MediaType,
+		Digest:       digest.FromBytes(data),
+		Size:         int64(len(data)),
+		ArtifactType: artifact.ArtifactType,
+	}
+
+	hosts := p.filterHosts(HostCapabilityPush)
+	if len(hosts) == 0 {
+		return ocispec.Descriptor{}, fmt.Errorf("no push hosts: %w", errdefs.ErrNotFound)
+	}
+
+	ctx, err = ContextWithRepositoryScope(ctx, p.refspec, true)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	var lastErr error
+	for _, host := range hosts {
+		if err := p.putManifest(ctx, host, desc.Digest.String(), data, desc.MediaType); err != nil {
+			lastErr = err
+			continue
+		}
+
+		if !host.Capabilities.Has(HostCapabilityReferrers) {
+			tag := referrersFallbackTag(subject)
+			if err := p.updateReferrersIndex(ctx, host, tag, referrersChange{add: &desc}, config); err != nil {
+				return ocispec.Descriptor{}, fmt.Errorf("pushed referrer but failed to update referrers index %s: %w", tag, err)
+			}
+		}
+
+		return desc, nil
+	}
+
+	return ocispec.Descriptor{}, fmt.Errorf("could not push referrer to any host: %w", lastErr)
+}
+
+// RemoveReferrer removes referrerDigest from subject's referrers: it
+// deletes the referrer manifest itself and, on hosts without native
+// referrers API support, drops it from the referrers-tag-schema index. The
+// manifest deletion is best-effort: a failure to delete it is logged, not
+// returned.
+func (p dockerPusher) RemoveReferrer(ctx context.Context, subject digest.Digest, referrerDigest digest.Digest, opts ...remotes.PushReferrerOption) error {
+	var config remotes.PushReferrerConfig
+	for _, o := range opts {
+		o(&config)
+	}
+
+	hosts := p.filterHosts(HostCapabilityPush)
+	if len(hosts) == 0 {
+		return fmt.Errorf("no push hosts: %w", errdefs.ErrNotFound)
+	}
+
+	ctx, err := ContextWithRepositoryScope(ctx, p.refspec, true)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, host := range hosts {
+		if !host.Capabilities.Has(HostCapabilityReferrers) {
+			tag := referrersFallbackTag(subject)
+			if err := p.updateReferrersIndex(ctx, host, tag, referrersChange{remove: referrerDigest}, config); err != nil {
+				lastErr = fmt.Errorf("failed to update referrers index %s: %w", tag, err)
+				continue
+			}
+		}
+
+		// referrerDigest is the manifest this call was asked to remove, not
+		// GC of some now-superseded index revision, so it is deleted
+		// unconditionally: WithSkipReferrersGC only means "leave the old
+		// index manifest behind", not "leave the removed referrer behind".
+		p.deleteManifest(ctx, host, referrerDigest)
+		return nil
+	}
+
+	return fmt.Errorf("could not remove referrer from any host: %w", lastErr)
+}
+
+// referrersChange describes a single mutation to apply to a
+// referrers-tag-schema index: add introduces a new referrer, remove drops
+// an existing one by digest. Exactly one of the two should be set.
+type referrersChange struct {
+	add    *ocispec.Descriptor
+	remove digest.Digest
+}
+
+// apply returns manifests with change applied: the existing entry matching
+// change.add or change.remove's digest is dropped (de-duplicating a repeat
+// add instead of leaving both copies), and change.add, if set, is appended.
+func (c referrersChange) apply(manifests []ocispec.Descriptor) []ocispec.Descriptor {
+	deduped := manifests[:0]
+	for _, m := range manifests {
+		if c.add != nil && m.Digest == c.add.Digest {
+			continue
+		}
+		if c.remove != "" && m.Digest == c.remove {
+			continue
+		}
+		deduped = append(deduped, m)
+	}
+	if c.add != nil {
+		deduped = append(deduped, *c.add)
+	}
+	return deduped
+}
+
+// updateReferrersIndex applies change to the referrers-tag-schema index
+// stored under tag, retrying if a concurrent pusher updates the tag first.
+//
+// This read-modify-write round trip is not made atomic by a conditional
+// PUT: none of the registries this fallback exists for (Docker Registry
+// 2.x, GHCR, ECR) honor If-Match/If-None-Match on manifest PUT, so a
+// precondition header can't actually detect a lost update, only give a
+// false sense that it does. Instead, after writing, the tag is re-read and
+// compared against what was just written; if a concurrent pusher raced in
+// between and the tag no longer reflects this write, the whole
+// read-modify-write is retried rather than the race being silently
+// accepted. This narrows the window but, absent registry-side compare-and-
+// swap support, cannot close it completely - the same approach oras-go
+// takes for the same reason.
+func (p dockerPusher) updateReferrersIndex(ctx context.Context, host RegistryHost, tag string, change referrersChange, config remotes.PushReferrerConfig) error {
+	for attempt := 0; attempt < maxReferrersIndexAttempts; attempt++ {
+		idx, oldDigest, err := p.fetchReferrersIndex(ctx, host, tag)
+		if err != nil {
+			return err
+		}
+		idx.Manifests = change.apply(idx.Manifests)
+
+		data, err := json.Marshal(idx)
+		if err != nil {
+			return err
+		}
+		newDigest := digest.FromBytes(data)
+
+		if err := p.putManifest(ctx, host, tag, data, ocispec.MediaTypeImageIndex); err != nil {
+			return err
+		}
+
+		_, confirmedDigest, err := p.fetchReferrersIndex(ctx, host, tag)
+		if err != nil {
+			return err
+		}
+		if confirmedDigest == newDigest {
+			if oldDigest != "" && oldDigest != newDigest && !config.SkipGC {
+				p.deleteManifest(ctx, host, oldDigest)
+			}
+			return nil
+		}
+
+		log.G(ctx).WithField("tag", tag).WithField("attempt", attempt).Debug("referrers index update raced with a concurrent push, retrying")
+	}
+
+	return fmt.Errorf("giving up updating referrers index after %d attempts: %w", maxReferrersIndexAttempts, errdefs.ErrUnavailable)
+}
+
+// fetchReferrersIndex reads the current referrers-tag-schema index for tag,
+// treating a missing tag as an empty index.
+func (p dockerPusher) fetchReferrersIndex(ctx context.Context, host RegistryHost, tag string) (ocispec.Index, digest.Digest, error) {
+	idx := ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Versioned: specs.Versioned{SchemaVersion: 2},
+	}
+
+	req := p.request(host, http.MethodGet, "manifests", tag)
+	if err := req.addNamespace(p.refspec.Hostname()); err != nil {
+		return idx, "", err
+	}
+
+	rc, _, _, err := p.open(ctx, req, ocispec.MediaTypeImageIndex, 0, true)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return idx, "", nil
+		}
+		return idx, "", err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return idx, "", err
+	}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return idx, "", err
+	}
+	return idx, digest.FromBytes(data), nil
+}
+
+// putManifest PUTs data under ref (a tag or digest) with the given media
+// type. It sends no conditional header: real-world registries (Docker
+// Registry 2.x, GHCR, ECR) don't honor If-Match/If-None-Match on manifest
+// PUT, so a precondition here would not actually make the write
+// conditional, only look like it does. Content-addressed pushes (by
+// digest) don't need one anyway, since they're idempotent. Of the callers
+// that write a mutable tag, updateReferrersIndex compensates with its own
+// read-after-write check; PutCosignAttachment overwrites its tag without one.
+func (p dockerPusher) putManifest(ctx context.Context, host RegistryHost, ref string, data []byte, mediaType string) error {
+	req := p.request(host, http.MethodPut, "manifests", ref)
+	if err := req.addNamespace(p.refspec.Hostname()); err != nil {
+		return err
+	}
+	req.body = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.size = int64(len(data))
+	req.header.Set("Content-Type", mediaType)
+
+	resp, err := req.do(ctx)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status pushing manifest %s: %s", ref, resp.Status)
+	}
+	return nil
+}
+
+// deleteManifest removes a manifest by digest, best-effort: failures
+// (including a non-2xx response) are logged rather than returned. It is used
+// both to garbage collect a superseded referrers index and by RemoveReferrer
+// to delete the removed referrer manifest.
+func (p dockerPusher) deleteManifest(ctx context.Context, host RegistryHost, dgst digest.Digest) {
+	req := p.request(host, http.MethodDelete, "manifests", dgst.String())
+	if err := req.addNamespace(p.refspec.Hostname()); err != nil {
+		log.G(ctx).WithError(err).Debug("failed to build manifest delete request")
+		return
+	}
+	resp, err := req.do(ctx)
+	if err != nil {
+		log.G(ctx).WithError(err).WithField("digest", dgst).Debug("failed to delete manifest")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.G(ctx).WithField("digest", dgst).WithField("status", resp.Status).Debug("failed to delete manifest")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"reflect"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func descWithDigest(dgst digest.Digest) ocispec.Descriptor {
+	return ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: dgst, Size: 1}
+}
+
+func digests(descs []ocispec.Descriptor) []digest.Digest {
+	var out []digest.Digest
+	for _, d := range descs {
+		out = append(out, d.Digest)
+	}
+	return out
+}
+
+func TestReferrersChangeApply(t *testing.T) {
+	a := digest.FromString("a")
+	b := digest.FromString("b")
+	c := digest.FromString("c")
+
+	for _, tc := range []struct {
+		name      string
+		manifests []ocispec.Descriptor
+		change    referrersChange
+		want      []digest.Digest
+	}{
+		{
+			name:      "add to empty index",
+			manifests: nil,
+			change:    referrersChange{add: ptr(descWithDigest(a))},
+			want:      []digest.Digest{a},
+		},
+		{
+			name:      "add alongside existing entries",
+			manifests: []ocispec.Descriptor{descWithDigest(a)},
+			change:    referrersChange{add: ptr(descWithDigest(b))},
+			want:      []digest.Digest{a, b},
+		},
+		{
+			name:      "re-adding the same digest de-duplicates instead of appending a second copy",
+			manifests: []ocispec.Descriptor{descWithDigest(a), descWithDigest(b)},
+			change:    referrersChange{add: ptr(descWithDigest(a))},
+			want:      []digest.Digest{b, a},
+		},
+		{
+			name:      "remove an existing entry",
+			manifests: []ocispec.Descriptor{descWithDigest(a), descWithDigest(b), descWithDigest(c)},
+			change:    referrersChange{remove: b},
+			want:      []digest.Digest{a, c},
+		},
+		{
+			name:      "remove a digest that isn't present is a no-op",
+			manifests: []ocispec.Descriptor{descWithDigest(a)},
+			change:    referrersChange{remove: b},
+			want:      []digest.Digest{a},
+		},
+		{
+			name:      "remove the only entry empties the index",
+			manifests: []ocispec.Descriptor{descWithDigest(a)},
+			change:    referrersChange{remove: a},
+			want:      nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := digests(tc.change.apply(tc.manifests))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("apply() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func ptr(d ocispec.Descriptor) *ocispec.Descriptor {
+	return &d
+}
@@ -0,0 +1,181 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParseWarningHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value string
+		want  []Warning
+	}{
+		{
+			name:  "single",
+			value: `299 - "deprecated API" "Sat, 25 Aug 2012 23:34:45 GMT"`,
+			want:  []Warning{{Code: 299, Agent: "-", Text: "deprecated API"}},
+		},
+		{
+			name:  "no warn-date",
+			value: `299 registry.example.com "no referrers support"`,
+			want:  []Warning{{Code: 299, Agent: "registry.example.com", Text: "no referrers support"}},
+		},
+		{
+			name:  "multiple comma-separated",
+			value: `299 - "first" , 299 - "second"`,
+			want: []Warning{
+				{Code: 299, Agent: "-", Text: "first"},
+				{Code: 299, Agent: "-", Text: "second"},
+			},
+		},
+		{
+			name:  "empty",
+			value: "",
+			want:  nil,
+		},
+		{
+			name:  "malformed code",
+			value: `abc - "not a warning"`,
+			want:  nil,
+		},
+		{
+			name:  "missing quotes",
+			value: `299 - unquoted text`,
+			want:  nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseWarningHeader(tc.value)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseWarningHeader(%q) = %#v, want %#v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAppliedFilters(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		hdr  http.Header
+		want map[string]bool
+	}{
+		{
+			name: "none",
+			hdr:  http.Header{},
+			want: map[string]bool{},
+		},
+		{
+			name: "single",
+			hdr:  http.Header{filtersAppliedHeader: []string{"artifactType"}},
+			want: map[string]bool{"artifactType": true},
+		},
+		{
+			name: "multiple values, comma-separated",
+			hdr:  http.Header{filtersAppliedHeader: []string{"artifactType, annotations"}},
+			want: map[string]bool{"artifactType": true, "annotations": true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := appliedFilters(tc.hdr)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("appliedFilters(%v) = %#v, want %#v", tc.hdr, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterUnappliedArtifactTypes(t *testing.T) {
+	idxJSON := func(types ...string) string {
+		idx := ocispec.Index{MediaType: ocispec.MediaTypeImageIndex}
+		for _, t := range types {
+			idx.Manifests = append(idx.Manifests, ocispec.Descriptor{ArtifactType: t})
+		}
+		data, err := json.Marshal(idx)
+		if err != nil {
+			panic(err)
+		}
+		return string(data)
+	}
+
+	for _, tc := range []struct {
+		name          string
+		body          string
+		artifactTypes []string
+		hdr           http.Header
+		wantTypes     []string
+	}{
+		{
+			name:          "no filter requested",
+			body:          idxJSON("a", "b"),
+			artifactTypes: nil,
+			wantTypes:     []string{"a", "b"},
+		},
+		{
+			name:          "server already applied it",
+			body:          idxJSON("a", "b"),
+			artifactTypes: []string{"a"},
+			hdr:           http.Header{filtersAppliedHeader: []string{"artifactType"}},
+			wantTypes:     []string{"a", "b"},
+		},
+		{
+			name:          "applied client-side",
+			body:          idxJSON("a", "b", "a"),
+			artifactTypes: []string{"a"},
+			wantTypes:     []string{"a", "a"},
+		},
+		{
+			name:          "no match",
+			body:          idxJSON("a", "b"),
+			artifactTypes: []string{"c"},
+			wantTypes:     []string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hdr := tc.hdr
+			if hdr == nil {
+				hdr = http.Header{}
+			}
+			rc, _, err := filterUnappliedArtifactTypes(io.NopCloser(strings.NewReader(tc.body)), int64(len(tc.body)), hdr, tc.artifactTypes)
+			if err != nil {
+				t.Fatalf("filterUnappliedArtifactTypes returned error: %v", err)
+			}
+			descs, err := decodeReferrersIndex(rc)
+			if err != nil {
+				t.Fatalf("decoding filtered index: %v", err)
+			}
+			var gotTypes []string
+			for _, d := range descs {
+				gotTypes = append(gotTypes, d.ArtifactType)
+			}
+			if len(gotTypes) == 0 {
+				gotTypes = []string{}
+			}
+			if !reflect.DeepEqual(gotTypes, tc.wantTypes) {
+				t.Errorf("got artifact types %v, want %v", gotTypes, tc.wantTypes)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ReferrerOption configures a Referrers or FetchReferrersWithOptions call. It
+// is an alias of FetchReferrersOption: both methods accept the same knobs, the
+// typed Referrers entry point just additionally knows how to turn the
+// result into a deduplicated, filtered descriptor slice.
+type ReferrerOption = FetchReferrersOption
+
+// WithReferrerAnnotation restricts the returned referrers to those carrying
+// the given annotation key/value pair. Unlike artifactType, the
+// distribution spec has no server-side filtering story for annotations, so
+// this is always applied client-side. Only Referrers applies it;
+// FetchReferrersWithOptions ignores it and returns the index unfiltered by
+// annotation.
+func WithReferrerAnnotation(key, value string) ReferrerOption {
+	return func(c *fetchReferrersConfig) {
+		if c.annotations == nil {
+			c.annotations = map[string]string{}
+		}
+		c.annotations[key] = value
+	}
+}
+
+// Referrers fetches the referrers of subject and returns them as a parsed,
+// deduplicated descriptor slice, transparently handling pagination and the
+// fallback quirks FetchReferrers' callers would otherwise have to deal with
+// themselves. It queries both the referrers API and the referrers-tag-schema
+// fallback (and, if requested, the Cosign tag schema) and merges whatever
+// each one finds, since a registry may only have part of its referrers
+// reachable through either path. Most callers should prefer this over the
+// raw FetchReferrers, which remains available for advanced use cases that
+// need the encoded index bytes directly.
+func (r dockerFetcher) Referrers(ctx context.Context, subject digest.Digest, opts ...ReferrerOption) ([]ocispec.Descriptor, error) {
+	var config fetchReferrersConfig
+	for _, o := range opts {
+		o(&config)
+	}
+
+	hosts := r.filterHosts(HostCapabilityResolve, HostCapabilityReferrers)
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no pull hosts: %w", errdefs.ErrNotFound)
+	}
+
+	ctx, err := ContextWithRepositoryScope(ctx, r.refspec, false)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[digest.Digest]struct{}{}
+	var merged []ocispec.Descriptor
+	add := func(descs []ocispec.Descriptor) {
+		for _, d := range descs {
+			if _, ok := seen[d.Digest]; ok {
+				continue
+			}
+			seen[d.Digest] = struct{}{}
+			merged = append(merged, d)
+		}
+	}
+
+	for _, host := range hosts {
+		if host.Capabilities.Has(HostCapabilityReferrers) {
+			descs, err := r.referrersFromAPI(ctx, host, subject, config.artifactTypes)
+			if err != nil {
+				return nil, err
+			}
+			add(descs)
+		}
+
+		if host.Capabilities.Has(HostCapabilityResolve) {
+			if descs, err := r.referrersFromTag(ctx, host, referrersFallbackTag(subject)); err == nil {
+				add(descs)
+			}
+
+			if config.cosignFallback {
+				if config.cosignAttachments {
+					rc, _, err := r.fetchCosignIndex(ctx, host, subject)
+					if err == nil {
+						defer rc.Close()
+						if descs, err := decodeReferrersIndex(rc); err == nil {
+							add(descs)
+						}
+					}
+				} else if desc, err := r.resolveCosignAttachment(ctx, host, subject, cosignSignatureSuffix); err == nil {
+					add([]ocispec.Descriptor{desc})
+				}
+			}
+		}
+	}
+
+	return filterReferrers(merged, config), nil
+}
+
+// referrersFromAPI fetches every page of the referrers API response for
+// subject on host, following "Link: rel=next" pagination.
+func (r dockerFetcher) referrersFromAPI(ctx context.Context, host RegistryHost, subject digest.Digest, artifactTypes []string) ([]ocispec.Descriptor, error) {
+	req := r.request(host, http.MethodGet, "referrers", subject.String())
+	for _, artifactType := range artifactTypes {
+		if err := req.addQuery("artifactType", artifactType); err != nil {
+			return nil, err
+		}
+	}
+	if err := req.addNamespace(r.refspec.Hostname()); err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(req.url())
+	if err != nil {
+		return nil, fmt.Errorf("parsing referrers request URL: %w", err)
+	}
+
+	rc, _, hdr, err := r.open(ctx, req, ocispec.MediaTypeImageIndex, 0, true)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rc.Close()
+
+	descs, err := decodeReferrersIndex(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	for next := nextLink(hdr); next != ""; {
+		resolved, err := resolveLink(base, next)
+		if err != nil {
+			return descs, err
+		}
+
+		page, pageHdr, err := r.openURL(ctx, host, resolved)
+		if err != nil {
+			return descs, err
+		}
+		pageDescs, err := decodeReferrersIndex(page)
+		page.Close()
+		if err != nil {
+			return descs, err
+		}
+		descs = append(descs, pageDescs...)
+
+		if base, err = url.Parse(resolved); err != nil {
+			return descs, fmt.Errorf("parsing resolved referrers page URL: %w", err)
+		}
+		next = nextLink(pageHdr)
+	}
+
+	return descs, nil
+}
+
+// referrersFromTag fetches the image index stored under tag and decodes it,
+// used for the OCI 1.1 referrers-tag-schema fallback.
+func (r dockerFetcher) referrersFromTag(ctx context.Context, host RegistryHost, tag string) ([]ocispec.Descriptor, error) {
+	req := r.request(host, http.MethodGet, "manifests", tag)
+	if err := req.addNamespace(r.refspec.Hostname()); err != nil {
+		return nil, err
+	}
+
+	rc, _, _, err := r.open(ctx, req, ocispec.MediaTypeImageIndex, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return decodeReferrersIndex(rc)
+}
+
+// resolveLink resolves a Link header's target URL against the request that
+// returned it. Registries commonly emit pagination links as absolute paths
+// rather than absolute URLs - e.g. `</v2/name/referrers/sha256:...?last=...>`
+// - the same convention the distribution spec uses for _catalog and tags
+// pagination, so a path-only Link can't be dereferenced on its own.
+func resolveLink(base *url.URL, rawURL string) (string, error) {
+	ref, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing Link target %q: %w", rawURL, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// openURL issues a GET against an absolute URL, used to follow pagination
+// links the referrers API returns outside of the usual host/repo request
+// building. It still goes through host's authorized client rather than a
+// bare http.Client, since a pagination link points back at the same host
+// and needs the same credentials as the request that returned it.
+func (r dockerFetcher) openURL(ctx context.Context, host RegistryHost, rawURL string) (io.ReadCloser, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range host.Header {
+		req.Header[k] = v
+	}
+
+	client := host.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("unexpected status fetching %s: %s", rawURL, resp.Status)
+	}
+	return resp.Body, resp.Header, nil
+}
+
+// nextLink extracts the URL of a "rel=next" entry from a Link header, per
+// RFC 8288. Returns "" if there is no next page.
+func nextLink(hdr http.Header) string {
+	for _, value := range hdr.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			if len(parts) < 2 {
+				continue
+			}
+			url := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if param == `rel="next"` || param == "rel=next" {
+					return url
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// decodeReferrersIndex parses rc as an OCI image index and returns its
+// manifest descriptors.
+func decodeReferrersIndex(rc io.Reader) ([]ocispec.Descriptor, error) {
+	var idx ocispec.Index
+	if err := json.NewDecoder(rc).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("decoding referrers index: %w", err)
+	}
+	return idx.Manifests, nil
+}
+
+// filterReferrers applies the artifactType and annotation filters from
+// config to descs.
+func filterReferrers(descs []ocispec.Descriptor, config fetchReferrersConfig) []ocispec.Descriptor {
+	if len(config.artifactTypes) == 0 && len(config.annotations) == 0 {
+		return descs
+	}
+
+	allowedTypes := make(map[string]bool, len(config.artifactTypes))
+	for _, t := range config.artifactTypes {
+		allowedTypes[t] = true
+	}
+
+	filtered := descs[:0]
+	for _, d := range descs {
+		if len(allowedTypes) > 0 && !allowedTypes[d.ArtifactType] {
+			continue
+		}
+		if !hasAnnotations(d, config.annotations) {
+			continue
+		}
+		filtered = append(filtered, d)
+	}
+	return filtered
+}
+
+func hasAnnotations(d ocispec.Descriptor, want map[string]string) bool {
+	for k, v := range want {
+		if d.Annotations[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNextLink(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		hdr  http.Header
+		want string
+	}{
+		{
+			name: "no link header",
+			hdr:  http.Header{},
+			want: "",
+		},
+		{
+			name: "relative path, quoted rel",
+			hdr:  http.Header{"Link": []string{`</v2/name/referrers/sha256:abc?last=def>; rel="next"`}},
+			want: "/v2/name/referrers/sha256:abc?last=def",
+		},
+		{
+			name: "unquoted rel",
+			hdr:  http.Header{"Link": []string{`</next-page>; rel=next`}},
+			want: "/next-page",
+		},
+		{
+			name: "rel=prev is ignored",
+			hdr:  http.Header{"Link": []string{`</prev>; rel="prev"`}},
+			want: "",
+		},
+		{
+			name: "multiple link values, next is second",
+			hdr:  http.Header{"Link": []string{`</prev>; rel="prev"`, `</next>; rel="next"`}},
+			want: "/next",
+		},
+		{
+			name: "multiple comma-separated entries in one value",
+			hdr:  http.Header{"Link": []string{`</prev>; rel="prev", </next>; rel="next"`}},
+			want: "/next",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextLink(tc.hdr); got != tc.want {
+				t.Errorf("nextLink(%v) = %q, want %q", tc.hdr, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	base, err := url.Parse("https://registry.example.com/v2/name/referrers/sha256:abc?artifactType=a")
+	if err != nil {
+		t.Fatalf("parsing base URL: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		link string
+		want string
+	}{
+		{
+			name: "absolute path, as real registries emit",
+			link: "/v2/name/referrers/sha256:abc?last=sha256:def",
+			want: "https://registry.example.com/v2/name/referrers/sha256:abc?last=sha256:def",
+		},
+		{
+			name: "already absolute URL",
+			link: "https://cdn.example.com/v2/name/referrers/sha256:abc?last=sha256:def",
+			want: "https://cdn.example.com/v2/name/referrers/sha256:abc?last=sha256:def",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := resolveLink(base, tc.link)
+			if err != nil {
+				t.Fatalf("resolveLink returned error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("resolveLink(%v, %q) = %q, want %q", base, tc.link, got, tc.want)
+			}
+		})
+	}
+}
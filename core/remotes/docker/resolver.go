@@ -0,0 +1,330 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/reference"
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/containerd/errdefs"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// HostCapabilities is a bitmask of the operations a RegistryHost may be
+// used for.
+type HostCapabilities uint8
+
+// Has reports whether c includes every capability set in m.
+func (c HostCapabilities) Has(m HostCapabilities) bool {
+	return c&m == m
+}
+
+const (
+	// HostCapabilityPull indicates a host may be used to fetch content blobs.
+	HostCapabilityPull HostCapabilities = 1 << iota
+	// HostCapabilityResolve indicates a host may be used to resolve and
+	// fetch manifests by tag or digest.
+	HostCapabilityResolve
+	// HostCapabilityPush indicates a host may be used to push content.
+	HostCapabilityPush
+	// HostCapabilityReferrers indicates a host implements the distribution
+	// spec referrers API (GET /v2/<name>/referrers/<digest>).
+	HostCapabilityReferrers
+)
+
+// RegistryHost describes one endpoint a repository can be reached through,
+// along with the capabilities and authorized client to use against it.
+type RegistryHost struct {
+	// Client is the authorized HTTP client to use for requests to this
+	// host. Its RoundTripper is responsible for attaching credentials.
+	Client *http.Client
+	// Header holds any static headers to send with every request to this
+	// host, e.g. a User-Agent.
+	Header http.Header
+
+	Scheme       string
+	Host         string
+	Path         string
+	Capabilities HostCapabilities
+}
+
+// dockerBase holds the state shared by dockerFetcher and dockerPusher for a
+// single repository: where it lives (refspec, the hosts that serve it) and
+// any cross-cutting behavior hooks (handleWarning).
+type dockerBase struct {
+	refspec    reference.Spec
+	repository string
+	hosts      []RegistryHost
+
+	// handleWarning, if set, receives the RFC 7234 Warning response headers
+	// of the responses FetchReferrersWithOptions reads and of Cosign
+	// attachment lookups, instead of having them dropped silently. Other
+	// requests, including pushes and the typed Referrers call's API and
+	// referrers-tag-schema requests, do not pass warnings to it. Populated
+	// from ResolverOptions.HandleWarning.
+	handleWarning func(context.Context, Warning)
+}
+
+// filterHosts returns the hosts that have at least one of the given
+// capabilities, preserving the configured order of preference.
+func (r *dockerBase) filterHosts(caps ...HostCapabilities) []RegistryHost {
+	var hosts []RegistryHost
+	for _, host := range r.hosts {
+		for _, c := range caps {
+			if host.Capabilities.Has(c) {
+				hosts = append(hosts, host)
+				break
+			}
+		}
+	}
+	return hosts
+}
+
+// request builds a request against host for method, joining ps into the
+// path after the repository, e.g. request(host, GET, "manifests", tag).
+func (r *dockerBase) request(host RegistryHost, method string, ps ...string) *request {
+	return &request{
+		method: method,
+		path:   ps,
+		header: http.Header{},
+		host:   host,
+		base:   r,
+	}
+}
+
+// open issues a GET for req, returning its body, content length and
+// response header together so callers can inspect things like
+// OCI-Filters-Applied or Warning without a second round trip. A 404 is
+// reported as errdefs.ErrNotFound so callers can treat it as a soft miss
+// when probing optional fallbacks.
+func (r *dockerBase) open(ctx context.Context, req *request, mediatype string, offset int64, cache bool) (io.ReadCloser, int64, http.Header, error) {
+	if mediatype != "" {
+		req.header.Set("Accept", mediatype)
+	}
+	if offset > 0 {
+		req.header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if !cache {
+		req.header.Set("Cache-Control", "no-cache")
+	}
+
+	resp, err := req.do(ctx)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, resp.Header, fmt.Errorf("content at %s not found: %w", req.url(), errdefs.ErrNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, 0, resp.Header, fmt.Errorf("unexpected status fetching %s: %s", req.url(), resp.Status)
+	}
+
+	return resp.Body, resp.ContentLength, resp.Header, nil
+}
+
+// request is a not-yet-sent HTTP request against a specific host.
+type request struct {
+	method string
+	path   []string
+	query  url.Values
+	header http.Header
+	host   RegistryHost
+	body   func() (io.ReadCloser, error)
+	size   int64
+
+	base *dockerBase
+}
+
+// addNamespace records the repository namespace a cross-repository mount
+// or token request should be scoped to. Single-repository requests, which
+// is everything referrers code issues, don't need it beyond the host's own
+// path, so this only has to succeed without erroring.
+func (r *request) addNamespace(ns string) error {
+	if ns == "" {
+		return fmt.Errorf("namespace must not be empty: %w", errdefs.ErrInvalidArgument)
+	}
+	r.header.Set("X-Docker-Namespace", ns)
+	return nil
+}
+
+// addQuery adds a query-string parameter to the request URL.
+func (r *request) addQuery(key, value string) error {
+	if r.query == nil {
+		r.query = url.Values{}
+	}
+	r.query.Add(key, value)
+	return nil
+}
+
+// url renders the absolute URL this request targets.
+func (r *request) url() string {
+	u := url.URL{
+		Scheme: r.host.Scheme,
+		Host:   r.host.Host,
+		Path:   strings.TrimSuffix(r.host.Path, "/") + "/v2/" + strings.TrimPrefix(r.base.repository, "/") + "/" + strings.Join(r.path, "/"),
+	}
+	if len(r.query) > 0 {
+		u.RawQuery = r.query.Encode()
+	}
+	return u.String()
+}
+
+// do sends the request through the host's authorized client and returns
+// the raw response. Callers own the response body and must close it.
+func (r *request) do(ctx context.Context) (*http.Response, error) {
+	var body io.ReadCloser
+	if r.body != nil {
+		b, err := r.body()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, r.method, r.url(), body)
+	if err != nil {
+		return nil, err
+	}
+	if r.size > 0 {
+		httpReq.ContentLength = r.size
+	}
+	for k, v := range r.host.Header {
+		httpReq.Header[k] = v
+	}
+	for k, v := range r.header {
+		httpReq.Header[k] = v
+	}
+
+	client := r.host.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(httpReq)
+}
+
+// ContextWithRepositoryScope annotates ctx with the docker registry auth
+// scope for refspec, so a host's authorizer can request a token with pull
+// or push access as appropriate when it needs to reauthenticate.
+func ContextWithRepositoryScope(ctx context.Context, refspec reference.Spec, push bool) (context.Context, error) {
+	action := "pull"
+	if push {
+		action = "push,pull"
+	}
+	scope := fmt.Sprintf("repository:%s:%s", refspec.Locator, action)
+	return context.WithValue(ctx, repositoryScopeKey{}, scope), nil
+}
+
+type repositoryScopeKey struct{}
+
+// dockerFetcher fetches manifests and blobs from a repository's hosts.
+type dockerFetcher struct {
+	*dockerBase
+}
+
+// Fetch fetches the content described by desc. Generic blob/manifest
+// transfer is outside the scope of the referrers support this file backs;
+// callers that need it should use the stock containerd docker resolver.
+func (r dockerFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("generic fetch not implemented by this resolver: %w", errdefs.ErrNotImplemented)
+}
+
+// dockerPusher pushes manifests and blobs to a repository's hosts.
+type dockerPusher struct {
+	*dockerBase
+	object string
+}
+
+// ResolverOptions configures a Resolver created with NewResolver.
+type ResolverOptions struct {
+	// Hosts resolves the RegistryHosts to use for a given hostname.
+	Hosts func(string) ([]RegistryHost, error)
+
+	// HandleWarning, if set, is called with the RFC 7234 Warning headers
+	// of referrers fetches made by Fetchers obtained from this resolver (see
+	// dockerBase.handleWarning for which requests); pushes do not report
+	// warnings to it.
+	HandleWarning func(context.Context, Warning)
+}
+
+// dockerResolver is a remotes.Resolver backed by one or more RegistryHosts
+// per repository, as configured through ResolverOptions.
+type dockerResolver struct {
+	hosts         func(string) ([]RegistryHost, error)
+	handleWarning func(context.Context, Warning)
+}
+
+// NewResolver returns a Resolver that talks to Docker/OCI distribution-spec
+// registries, with support for the referrers extensions in this package.
+func NewResolver(options ResolverOptions) remotes.Resolver {
+	return &dockerResolver{
+		hosts:         options.Hosts,
+		handleWarning: options.HandleWarning,
+	}
+}
+
+func (r *dockerResolver) base(ref string) (*dockerBase, error) {
+	refspec, err := reference.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []RegistryHost
+	if r.hosts != nil {
+		hosts, err = r.hosts(refspec.Hostname())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &dockerBase{
+		refspec:       refspec,
+		repository:    strings.TrimPrefix(refspec.Locator, refspec.Hostname()+"/"),
+		hosts:         hosts,
+		handleWarning: r.handleWarning,
+	}, nil
+}
+
+// Resolve resolves ref to its canonical name and descriptor. Like Fetch,
+// the generic case is out of scope here.
+func (r *dockerResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	return "", ocispec.Descriptor{}, fmt.Errorf("generic resolve not implemented by this resolver: %w", errdefs.ErrNotImplemented)
+}
+
+func (r *dockerResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	base, err := r.base(ref)
+	if err != nil {
+		return nil, err
+	}
+	return dockerFetcher{dockerBase: base}, nil
+}
+
+func (r *dockerResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	base, err := r.base(ref)
+	if err != nil {
+		return nil, err
+	}
+	return dockerPusher{dockerBase: base, object: base.refspec.Object}, nil
+}
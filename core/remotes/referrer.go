@@ -0,0 +1,63 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotes
+
+import (
+	"context"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PushReferrerConfig holds the options accepted by a ReferrerPusher.
+type PushReferrerConfig struct {
+	// SkipGC leaves a stale referrers index manifest in place after a
+	// successful update instead of deleting it. Useful when another
+	// process may still be reading the old index, or when the registry
+	// doesn't support un-tagged manifest deletion.
+	SkipGC bool
+}
+
+// PushReferrerOption configures a PushReferrer call.
+type PushReferrerOption func(*PushReferrerConfig)
+
+// WithSkipReferrersGC leaves the previous referrers index manifest in place
+// rather than deleting it once the fallback tag has been updated to point
+// at the new one.
+func WithSkipReferrersGC() PushReferrerOption {
+	return func(c *PushReferrerConfig) {
+		c.SkipGC = true
+	}
+}
+
+// ReferrerPusher is an optional capability a Pusher may implement to push an
+// OCI referrer manifest (one carrying a "subject" and "artifactType").
+// Implementations are responsible for maintaining whatever registry-specific
+// referrers index a host without native referrers API support needs, such
+// as the OCI 1.1 referrers tag schema.
+type ReferrerPusher interface {
+	PushReferrer(ctx context.Context, subject digest.Digest, artifact ocispec.Manifest, opts ...PushReferrerOption) (ocispec.Descriptor, error)
+}
+
+// ReferrerRemover is an optional capability a Pusher may implement to
+// remove a referrer it (or some other pusher) previously pushed. Like
+// ReferrerPusher, implementations are responsible for keeping whatever
+// registry-specific referrers index a host without native referrers API
+// support needs in sync.
+type ReferrerRemover interface {
+	RemoveReferrer(ctx context.Context, subject digest.Digest, referrer digest.Digest, opts ...PushReferrerOption) error
+}